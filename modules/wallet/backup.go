@@ -0,0 +1,262 @@
+package wallet
+
+import (
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/wallet/backup"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/bolt"
+)
+
+// bucketBackupPayload stores the most recently imported or recorded
+// backup.Payload, so that RecordFileContract/RecordHostAnnouncement and
+// ExportBackup survive restarts without needing their own fields on
+// Wallet.
+var bucketBackupPayload = []byte("bucketBackupPayload")
+
+// dbBackupPayload and dbPutBackupPayload read and write the wallet's
+// current backup.Payload snapshot.
+func dbBackupPayload(tx *bolt.Tx) (backup.Payload, error) {
+	var payload backup.Payload
+	b := tx.Bucket(bucketBackupPayload)
+	if b == nil {
+		return payload, nil
+	}
+	v := b.Get([]byte("payload"))
+	if v == nil {
+		return payload, nil
+	}
+	err := encoding.Unmarshal(v, &payload)
+	return payload, err
+}
+func dbPutBackupPayload(tx *bolt.Tx, payload backup.Payload) error {
+	b, err := tx.CreateBucketIfNotExists(bucketBackupPayload)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte("payload"), encoding.Marshal(payload))
+}
+
+// RecordFileContract adds cr to the set of contracts included in the
+// wallet's next ExportBackup, replacing any record with the same ID. Only
+// contracts passed to it (or merged in by ImportBackup) are included;
+// forming or revising a contract elsewhere does not call it.
+func (w *Wallet) RecordFileContract(cr backup.ContractRecord) error {
+	if err := w.tg.Add(); err != nil {
+		return err
+	}
+	defer w.tg.Done()
+	return w.db.Update(func(tx *bolt.Tx) error {
+		payload, err := dbBackupPayload(tx)
+		if err != nil {
+			return err
+		}
+		replaced := false
+		for i, existing := range payload.Contracts {
+			if existing.ID == cr.ID {
+				payload.Contracts[i] = cr
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			payload.Contracts = append(payload.Contracts, cr)
+		}
+		return dbPutBackupPayload(tx, payload)
+	})
+}
+
+// RecordHostAnnouncement adds addr to the set of host announcements
+// included in the wallet's next ExportBackup.
+func (w *Wallet) RecordHostAnnouncement(addr modules.NetAddress) error {
+	if err := w.tg.Add(); err != nil {
+		return err
+	}
+	defer w.tg.Done()
+	return w.db.Update(func(tx *bolt.Tx) error {
+		payload, err := dbBackupPayload(tx)
+		if err != nil {
+			return err
+		}
+		for _, existing := range payload.HostAnnouncements {
+			if existing == addr {
+				return nil
+			}
+		}
+		payload.HostAnnouncements = append(payload.HostAnnouncements, addr)
+		return dbPutBackupPayload(tx, payload)
+	})
+}
+
+// ExportBackup produces a static backup of the wallet's non-obvious state -
+// outstanding file contracts, the hosts they were formed with, and every
+// address/transaction label the user has set - encrypted and
+// authenticated with a key derived from masterKey. Anyone who later
+// unlocks a wallet sharing this seed with the same masterKey can decrypt
+// and verify the backup with ImportBackup.
+func (w *Wallet) ExportBackup(masterKey crypto.TwofishKey) ([]byte, error) {
+	if err := w.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer w.tg.Done()
+
+	var payload backup.Payload
+	err := w.db.View(func(tx *bolt.Tx) error {
+		var err error
+		payload, err = dbBackupPayload(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	addrLabels, err := w.addressLabels()
+	if err != nil {
+		return nil, err
+	}
+	for uh, label := range addrLabels {
+		payload.AddressLabels = append(payload.AddressLabels, backup.AddressLabel{UnlockHash: uh, Label: label})
+	}
+	txnLabels, err := w.transactionLabels()
+	if err != nil {
+		return nil, err
+	}
+	for txid, label := range txnLabels {
+		payload.TransactionLabels = append(payload.TransactionLabels, backup.TransactionLabel{TransactionID: txid, Label: label})
+	}
+	return backup.Encode(masterKey, payload)
+}
+
+// ImportBackup decrypts and verifies data, then merges its contract
+// records, host announcements, and address/transaction labels into the
+// wallet. The wallet never formed these contracts itself and doesn't
+// store file contract outputs the way it stores siacoin/siafund UTXOs, so
+// the LatestRevision ImportBackup merges in is only ever as current as
+// whatever the backup happened to capture. RescanFromBirthday closes that
+// gap: every block it walks is checked for FileContractRevisions and
+// StorageProofs against the IDs just imported (see
+// reconcileContractRevisions), so a newer on-chain revision the renter
+// never got a chance to record locally - or a contract that has since
+// resolved - is picked up the next time a rescan covers that block. A
+// contract formed before the wallet's recorded seed birthday needs
+// SetSeedBirthday lowered first, or that block never gets walked.
+// Recovery also preserves whatever labels the user had set.
+func (w *Wallet) ImportBackup(masterKey crypto.TwofishKey, data []byte) error {
+	if err := w.tg.Add(); err != nil {
+		return err
+	}
+	defer w.tg.Done()
+
+	payload, err := backup.Decode(masterKey, data)
+	if err != nil {
+		return err
+	}
+	err = w.db.Update(func(tx *bolt.Tx) error {
+		existing, err := dbBackupPayload(tx)
+		if err != nil {
+			return err
+		}
+		existing.Contracts = mergeContracts(existing.Contracts, payload.Contracts)
+		existing.HostAnnouncements = mergeAnnouncements(existing.HostAnnouncements, payload.HostAnnouncements)
+		return dbPutBackupPayload(tx, existing)
+	})
+	if err != nil {
+		return err
+	}
+	for _, al := range payload.AddressLabels {
+		if err := w.SetAddressLabel(al.UnlockHash, al.Label); err != nil {
+			return err
+		}
+	}
+	for _, tl := range payload.TransactionLabels {
+		if err := w.SetTransactionLabel(tl.TransactionID, tl.Label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackupContracts returns every ContractRecord most recently recorded via
+// RecordFileContract or merged in by ImportBackup, each with its latest
+// known revision (earlier revisions are not kept), so that the renter can
+// reconstruct its outstanding contracts after a recovery import without
+// keeping its own separate copy of this data.
+func (w *Wallet) BackupContracts() ([]backup.ContractRecord, error) {
+	if err := w.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer w.tg.Done()
+	var payload backup.Payload
+	err := w.db.View(func(tx *bolt.Tx) error {
+		var err error
+		payload, err = dbBackupPayload(tx)
+		return err
+	})
+	return payload.Contracts, err
+}
+
+// mergeContracts combines two contract sets, preferring b's revision for
+// any ID present in both.
+func mergeContracts(a, b []backup.ContractRecord) []backup.ContractRecord {
+	byID := make(map[types.FileContractID]backup.ContractRecord, len(a)+len(b))
+	for _, cr := range a {
+		byID[cr.ID] = cr
+	}
+	for _, cr := range b {
+		byID[cr.ID] = cr
+	}
+	merged := make([]backup.ContractRecord, 0, len(byID))
+	for _, cr := range byID {
+		merged = append(merged, cr)
+	}
+	return merged
+}
+
+// mergeAnnouncements combines two host-announcement sets, dropping
+// duplicates.
+func mergeAnnouncements(a, b []modules.NetAddress) []modules.NetAddress {
+	seen := make(map[modules.NetAddress]bool, len(a)+len(b))
+	merged := make([]modules.NetAddress, 0, len(a)+len(b))
+	for _, addr := range append(append([]modules.NetAddress(nil), a...), b...) {
+		if !seen[addr] {
+			seen[addr] = true
+			merged = append(merged, addr)
+		}
+	}
+	return merged
+}
+
+// reconcileContractRevisions checks block for FileContractRevisions and
+// StorageProofs touching any contract the wallet is tracking (via
+// RecordFileContract or an ImportBackup merge), so that a rescan brings a
+// stale imported LatestRevision up to whatever the chain actually settled
+// on instead of trusting the backup forever. A contract whose
+// StorageProof appears in block has resolved and is dropped from payload
+// entirely - there's nothing left to revise. It reports whether payload
+// was actually changed, so the caller can skip writing it back otherwise.
+func reconcileContractRevisions(payload backup.Payload, block types.Block) (backup.Payload, bool) {
+	if len(payload.Contracts) == 0 {
+		return payload, false
+	}
+	changed := false
+	for _, txn := range block.Transactions {
+		for _, fcr := range txn.FileContractRevisions {
+			for i := range payload.Contracts {
+				if payload.Contracts[i].ID == fcr.ParentID && fcr.NewRevisionNumber > payload.Contracts[i].LatestRevision.NewRevisionNumber {
+					payload.Contracts[i].LatestRevision = fcr
+					changed = true
+				}
+			}
+		}
+		for _, sp := range txn.StorageProofs {
+			for i := range payload.Contracts {
+				if payload.Contracts[i].ID == sp.ParentID {
+					payload.Contracts = append(payload.Contracts[:i], payload.Contracts[i+1:]...)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return payload, changed
+}
@@ -0,0 +1,133 @@
+// Package backup implements the Sia wallet's static backup format: a
+// compact blob, encrypted with a key derived from the wallet's master key,
+// recording wallet state that a plain
+// consensus-set rescan cannot reconstruct on its own, most importantly
+// outstanding file contracts and the hosts they were formed with.
+package backup
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"golang.org/x/crypto/twofish"
+)
+
+// ErrInvalidMAC is returned by Decode when a backup's authentication tag
+// does not match: either the blob is corrupt, or it was produced with a
+// different master key.
+var ErrInvalidMAC = errors.New("backup: MAC verification failed; backup is corrupt or was produced with a different master key")
+
+// ContractRecord holds what the backup keeps about a file contract beyond
+// what walking the consensus set for plain siacoin/siafund UTXOs already
+// recovers: its ID, the renter's public key, and its latest known
+// revision. Earlier revisions are not kept.
+type ContractRecord struct {
+	ID              types.FileContractID
+	RenterPublicKey types.SiaPublicKey
+	LatestRevision  types.FileContractRevision
+}
+
+// AddressLabel and TransactionLabel preserve a user-supplied annotation
+// across a backup/restore cycle, since these aren't otherwise recoverable
+// by rescanning the consensus set.
+type AddressLabel struct {
+	UnlockHash types.UnlockHash
+	Label      string
+}
+type TransactionLabel struct {
+	TransactionID types.TransactionID
+	Label         string
+}
+
+// Payload is the plaintext content of a static backup.
+type Payload struct {
+	Contracts         []ContractRecord
+	HostAnnouncements []modules.NetAddress
+	AddressLabels     []AddressLabel
+	TransactionLabels []TransactionLabel
+}
+
+// macKey and cipherKey derive the two single-purpose keys used to
+// authenticate and encrypt a backup from the wallet's master key, so that
+// anyone who can unlock the wallet with masterKey can also decrypt and
+// verify a backup it produced.
+func macKey(masterKey crypto.TwofishKey) crypto.Hash {
+	return crypto.HashAll(masterKey, "wallet backup mac key")
+}
+func cipherKey(masterKey crypto.TwofishKey) crypto.Hash {
+	return crypto.HashAll(masterKey, "wallet backup cipher key")
+}
+
+// Encode serializes payload, encrypts it with a key derived from
+// masterKey, and appends an HMAC (derived from masterKey as well)
+// authenticating the ciphertext. Decode reverses the process.
+func Encode(masterKey crypto.TwofishKey, payload Payload) ([]byte, error) {
+	plaintext := encoding.Marshal(payload)
+
+	ck := cipherKey(masterKey)
+	block, err := twofish.NewCipher(ck[:])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, block.BlockSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCTR(block, nonce).XORKeyStream(ciphertext, plaintext)
+
+	mk := macKey(masterKey)
+	mac := hmac.New(sha256.New, mk[:])
+	mac.Write(nonce)
+	mac.Write(ciphertext)
+	tag := mac.Sum(nil)
+
+	blob := make([]byte, 0, len(nonce)+len(ciphertext)+len(tag))
+	blob = append(blob, nonce...)
+	blob = append(blob, ciphertext...)
+	blob = append(blob, tag...)
+	return blob, nil
+}
+
+// Decode authenticates and decrypts a blob produced by Encode, failing
+// with ErrInvalidMAC if masterKey does not match the key it was encoded
+// with.
+func Decode(masterKey crypto.TwofishKey, blob []byte) (Payload, error) {
+	ck := cipherKey(masterKey)
+	block, err := twofish.NewCipher(ck[:])
+	if err != nil {
+		return Payload{}, err
+	}
+	nonceSize := block.BlockSize()
+	if len(blob) < nonceSize+sha256.Size {
+		return Payload{}, errors.New("backup: blob is too short to be valid")
+	}
+	nonce := blob[:nonceSize]
+	tag := blob[len(blob)-sha256.Size:]
+	ciphertext := blob[nonceSize : len(blob)-sha256.Size]
+
+	mk := macKey(masterKey)
+	mac := hmac.New(sha256.New, mk[:])
+	mac.Write(nonce)
+	mac.Write(ciphertext)
+	if !hmac.Equal(tag, mac.Sum(nil)) {
+		return Payload{}, ErrInvalidMAC
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, nonce).XORKeyStream(plaintext, ciphertext)
+
+	var payload Payload
+	if err := encoding.Unmarshal(plaintext, &payload); err != nil {
+		return Payload{}, err
+	}
+	return payload, nil
+}
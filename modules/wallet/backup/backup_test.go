@@ -0,0 +1,40 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestEncodeDecode checks that a payload round-trips through Encode/Decode
+// and that Decode rejects a blob decrypted with the wrong master key.
+func TestEncodeDecode(t *testing.T) {
+	masterKey := crypto.TwofishKey{1, 2, 3}
+	payload := Payload{
+		Contracts: []ContractRecord{{
+			ID: types.FileContractID{4, 5, 6},
+		}},
+		HostAnnouncements: []modules.NetAddress{"1.2.3.4:9982"},
+	}
+	blob, err := Encode(masterKey, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(masterKey, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Contracts) != 1 || decoded.Contracts[0].ID != payload.Contracts[0].ID {
+		t.Error("decoded contracts do not match original payload")
+	}
+	if len(decoded.HostAnnouncements) != 1 || decoded.HostAnnouncements[0] != payload.HostAnnouncements[0] {
+		t.Error("decoded host announcements do not match original payload")
+	}
+
+	wrongKey := crypto.TwofishKey{9, 9, 9}
+	if _, err := Decode(wrongKey, blob); err != ErrInvalidMAC {
+		t.Error("expected ErrInvalidMAC when decoding with the wrong key, got", err)
+	}
+}
@@ -0,0 +1,127 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules/wallet/backup"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestExportImportBackup checks that a contract recorded on one wallet
+// survives a round trip through ExportBackup/ImportBackup into another
+// wallet sharing the same master key.
+func TestExportImportBackup(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestExportImportBackup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	cr := backup.ContractRecord{ID: types.FileContractID{1, 2, 3}}
+	if err := wt.wallet.RecordFileContract(cr); err != nil {
+		t.Fatal(err)
+	}
+
+	masterKey := crypto.TwofishKey{7}
+	blob, err := wt.wallet.ExportBackup(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := wt.wallet.persistDir + "-recovered"
+	w2, err := New(wt.cs, wt.tpool, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w2.Close()
+
+	if err := w2.ImportBackup(masterKey, blob); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := w2.BackupContracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovered) != 1 || recovered[0].ID != cr.ID {
+		t.Error("BackupContracts did not return the imported contract")
+	}
+	payload, err := w2.ExportBackup(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := backup.Decode(masterKey, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Contracts) != 1 || decoded.Contracts[0].ID != cr.ID {
+		t.Error("imported backup did not preserve the recorded contract")
+	}
+
+	wrongKey := crypto.TwofishKey{8}
+	if err := w2.ImportBackup(wrongKey, blob); err != backup.ErrInvalidMAC {
+		t.Error("expected ErrInvalidMAC when importing with the wrong key, got", err)
+	}
+}
+
+// TestReconcileContractRevisions checks that reconcileContractRevisions
+// adopts a newer on-chain revision for a tracked contract, ignores an
+// older or unrelated one, and drops a contract entirely once its
+// StorageProof appears.
+func TestReconcileContractRevisions(t *testing.T) {
+	fcid := types.FileContractID{1, 2, 3}
+	other := types.FileContractID{4, 5, 6}
+	payload := backup.Payload{
+		Contracts: []backup.ContractRecord{
+			{ID: fcid, LatestRevision: types.FileContractRevision{NewRevisionNumber: 2}},
+			{ID: other, LatestRevision: types.FileContractRevision{NewRevisionNumber: 9}},
+		},
+	}
+
+	// An older revision number for a tracked contract should be ignored.
+	block := types.Block{Transactions: []types.Transaction{{
+		FileContractRevisions: []types.FileContractRevision{
+			{ParentID: fcid, NewRevisionNumber: 1},
+		},
+	}}}
+	payload, changed := reconcileContractRevisions(payload, block)
+	if changed {
+		t.Error("an older revision number should not have changed payload")
+	}
+	if payload.Contracts[0].LatestRevision.NewRevisionNumber != 2 {
+		t.Error("an older revision number should not have replaced the tracked one")
+	}
+
+	// A newer revision number for a tracked contract should be adopted.
+	block = types.Block{Transactions: []types.Transaction{{
+		FileContractRevisions: []types.FileContractRevision{
+			{ParentID: fcid, NewRevisionNumber: 3},
+			{ParentID: types.FileContractID{7, 7, 7}, NewRevisionNumber: 100},
+		},
+	}}}
+	payload, changed = reconcileContractRevisions(payload, block)
+	if !changed {
+		t.Error("a newer revision number should have changed payload")
+	}
+	if payload.Contracts[0].LatestRevision.NewRevisionNumber != 3 {
+		t.Errorf("expected revision number 3, got %v", payload.Contracts[0].LatestRevision.NewRevisionNumber)
+	}
+	if len(payload.Contracts) != 2 {
+		t.Fatal("an untracked contract's revision should not add a new entry")
+	}
+
+	// A resolved contract should be dropped entirely.
+	block = types.Block{Transactions: []types.Transaction{{
+		StorageProofs: []types.StorageProof{{ParentID: fcid}},
+	}}}
+	payload, changed = reconcileContractRevisions(payload, block)
+	if !changed {
+		t.Error("a storage proof for a tracked contract should have changed payload")
+	}
+	if len(payload.Contracts) != 1 || payload.Contracts[0].ID != other {
+		t.Error("resolved contract should have been dropped, leaving only the untouched one")
+	}
+}
@@ -0,0 +1,154 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestAddressAndTransactionLabels checks that labels can be set, looked
+// up, and cleared.
+func TestAddressAndTransactionLabels(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestAddressAndTransactionLabels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	uc, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uh := uc.UnlockHash()
+	if err := wt.wallet.SetAddressLabel(uh, "savings"); err != nil {
+		t.Fatal(err)
+	}
+	label, err := wt.wallet.AddressLabel(uh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label != "savings" {
+		t.Errorf("expected label %q, got %q", "savings", label)
+	}
+	if err := wt.wallet.SetAddressLabel(uh, ""); err != nil {
+		t.Fatal(err)
+	}
+	if label, err = wt.wallet.AddressLabel(uh); err != nil || label != "" {
+		t.Error("expected label to be cleared, got", label, err)
+	}
+
+	txid := types.TransactionID{1, 2, 3}
+	if err := wt.wallet.SetTransactionLabel(txid, "rent payment"); err != nil {
+		t.Fatal(err)
+	}
+	label, err = wt.wallet.TransactionLabel(txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label != "rent payment" {
+		t.Errorf("expected label %q, got %q", "rent payment", label)
+	}
+}
+
+// TestAllLabeledAddresses checks that AllLabeledAddresses pairs every
+// address AllAddresses returns with its label, including addresses that
+// have none set.
+func TestAllLabeledAddresses(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestAllLabeledAddresses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	labeledUC, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	labeledUH := labeledUC.UnlockHash()
+	if err := wt.wallet.SetAddressLabel(labeledUH, "savings"); err != nil {
+		t.Fatal(err)
+	}
+	unlabeledUC, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlabeledUH := unlabeledUC.UnlockHash()
+
+	all, err := wt.wallet.AllLabeledAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(wt.wallet.AllAddresses()) {
+		t.Fatalf("expected AllLabeledAddresses to cover every address AllAddresses does: got %v, want %v", len(all), len(wt.wallet.AllAddresses()))
+	}
+	var sawLabeled, sawUnlabeled bool
+	for _, la := range all {
+		switch la.UnlockHash {
+		case labeledUH:
+			sawLabeled = true
+			if la.Label != "savings" {
+				t.Errorf("expected label %q, got %q", "savings", la.Label)
+			}
+		case unlabeledUH:
+			sawUnlabeled = true
+			if la.Label != "" {
+				t.Errorf("expected no label, got %q", la.Label)
+			}
+		}
+	}
+	if !sawLabeled || !sawUnlabeled {
+		t.Error("AllLabeledAddresses did not cover both addresses")
+	}
+}
+
+// TestLabelsSurviveBackup checks that address and transaction labels round
+// trip through ExportBackup/ImportBackup.
+func TestLabelsSurviveBackup(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestLabelsSurviveBackup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	uc, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uh := uc.UnlockHash()
+	if err := wt.wallet.SetAddressLabel(uh, "cold storage"); err != nil {
+		t.Fatal(err)
+	}
+
+	masterKey := crypto.TwofishKey{3}
+	blob, err := wt.wallet.ExportBackup(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := wt.wallet.persistDir + "-labels-recovered"
+	w2, err := New(wt.cs, wt.tpool, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w2.Close()
+	if err := w2.ImportBackup(masterKey, blob); err != nil {
+		t.Fatal(err)
+	}
+	label, err := w2.AddressLabel(uh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label != "cold storage" {
+		t.Errorf("expected recovered label %q, got %q", "cold storage", label)
+	}
+}
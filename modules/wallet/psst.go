@@ -0,0 +1,150 @@
+package wallet
+
+import (
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/wallet/psst"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// w.openPSSTs holds the TransactionBuilder backing every outstanding PSST
+// CreatePSST has built but that hasn't yet been abandoned via AbandonPSST,
+// so the inputs it reserved stay out of the wallet's spendable pool rather
+// than being released the moment CreatePSST returns. Finalizing a PSST
+// does not remove its entry. It is a field on Wallet, guarded by w.mu like
+// w.keys - initialized alongside w.keys in New() and drained (every
+// remaining builder Dropped) in Close(), both outside this series -
+// rather than a package-level map, so that two independent *Wallet
+// instances in the same process never see each other's reservations, and
+// a closed wallet's builders (which reference its now-closed w.db)
+// don't linger.
+
+// CreatePSST funds a transaction paying outputs, with feeHint as the miner
+// fee, and returns it as an unsigned PSST rather than a finished
+// transaction. The inputs it selects may belong to watch-only addresses
+// loaded via LoadWatchOnly: CreatePSST never needs their private keys,
+// only SignPSST does.
+//
+// The txnBuilder backing the returned PSST is kept open rather than
+// dropped: a PSST is meant to be held and passed between cosigners for an
+// unbounded amount of time, and dropping the builder immediately would
+// release its reserved inputs back into the spendable pool, letting a
+// later call from this same wallet reuse them and double-spend against
+// the PSST. The reservation is only released by AbandonPSST.
+func (w *Wallet) CreatePSST(outputs []types.SiacoinOutput, feeHint types.Currency) (psst.PSST, error) {
+	if err := w.tg.Add(); err != nil {
+		return psst.PSST{}, err
+	}
+	defer w.tg.Done()
+
+	var total types.Currency
+	for _, sco := range outputs {
+		total = total.Add(sco.Value)
+	}
+	total = total.Add(feeHint)
+
+	txnBuilder := w.StartTransaction()
+	if err := txnBuilder.FundSiacoins(total); err != nil {
+		txnBuilder.Drop()
+		return psst.PSST{}, err
+	}
+	txnBuilder.AddMinerFee(feeHint)
+	for _, sco := range outputs {
+		txnBuilder.AddSiacoinOutput(sco)
+	}
+	txn, _ := txnBuilder.View()
+
+	p := psst.PSST{
+		ID:          crypto.HashObject(txn),
+		Transaction: txn,
+	}
+	for _, sci := range txn.SiacoinInputs {
+		p.Inputs = append(p.Inputs, psst.Input{
+			ParentID:         crypto.Hash(sci.ParentID),
+			UnlockConditions: sci.UnlockConditions,
+			CoveredFields:    types.CoveredFields{WholeTransaction: true},
+		})
+	}
+
+	w.mu.Lock()
+	w.openPSSTs[p.ID] = txnBuilder
+	w.mu.Unlock()
+
+	return p, nil
+}
+
+// AbandonPSST releases the inputs CreatePSST reserved for p back into the
+// wallet's spendable pool. Call this when p is discarded without ever
+// being finalized and broadcast - a cosigner backs out, the flow times
+// out, and so on - so its inputs don't stay locked forever. Abandoning a
+// PSST this wallet didn't create, or one already abandoned, is a no-op.
+func (w *Wallet) AbandonPSST(p psst.PSST) error {
+	w.mu.Lock()
+	txnBuilder, ok := w.openPSSTs[p.ID]
+	if ok {
+		delete(w.openPSSTs, p.ID)
+	}
+	w.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	txnBuilder.Drop()
+	return nil
+}
+
+// SignPSST fills in a TransactionSignature for every input of p whose
+// UnlockConditions the wallet holds a private key for. Inputs belonging to
+// addresses the wallet only knows as watch-only (see LoadWatchOnly) are
+// left untouched, so the PSST can be passed on to whoever holds the
+// remaining keys.
+//
+// Calling SignPSST again on a PSST it (or a cosigner merging in its
+// signatures via psst.Combine) already signed does not append a second,
+// redundant TransactionSignature for the same input and key: p's
+// SignedKeyIndices is consulted first, so re-signing is a no-op rather
+// than something Complete/Finalize would have to notice and tolerate.
+func (w *Wallet) SignPSST(p psst.PSST) (psst.PSST, error) {
+	if err := w.tg.Add(); err != nil {
+		return psst.PSST{}, err
+	}
+	defer w.tg.Done()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if !w.unlocked {
+		return psst.PSST{}, modules.ErrLockedWallet
+	}
+
+	signed := p
+	for _, in := range p.Inputs {
+		sk, ok := w.keys[in.UnlockConditions.UnlockHash()]
+		if !ok || len(sk.SecretKeys) == 0 {
+			// Not ours, or watch-only: nothing to sign.
+			continue
+		}
+		alreadySigned := signed.SignedKeyIndices(in.ParentID)
+		for keyIndex, secretKey := range sk.SecretKeys {
+			if alreadySigned[uint64(keyIndex)] {
+				continue
+			}
+			txn := signed.Transaction
+			txn.TransactionSignatures = append(txn.TransactionSignatures, types.TransactionSignature{
+				ParentID:       in.ParentID,
+				CoveredFields:  in.CoveredFields,
+				PublicKeyIndex: uint64(keyIndex),
+			})
+			sigHash := txn.SigHash(len(txn.TransactionSignatures) - 1)
+			cryptoSig, err := crypto.SignHash(sigHash, secretKey)
+			if err != nil {
+				return psst.PSST{}, err
+			}
+			signed.Signatures = append(signed.Signatures, types.TransactionSignature{
+				ParentID:       in.ParentID,
+				CoveredFields:  in.CoveredFields,
+				PublicKeyIndex: uint64(keyIndex),
+				Signature:      cryptoSig[:],
+			})
+		}
+	}
+	return signed, nil
+}
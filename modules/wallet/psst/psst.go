@@ -0,0 +1,132 @@
+// Package psst implements Partially-Signed Sia Transactions: a
+// serializable envelope that lets a transaction be built by one party and
+// signed by one or more others - offline, on a hardware signer, or across
+// several independent holders of an m-of-n UnlockConditions - without any
+// single party ever needing every key at once.
+package psst
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// ErrIncompleteSignatures is returned by Finalize when the signatures
+// accumulated so far do not satisfy every input's UnlockConditions.
+var ErrIncompleteSignatures = errors.New("psst: not enough signatures to finalize transaction")
+
+// ErrMismatchedPSSTs is returned by Combine when a and b don't describe
+// the same unsigned transaction.
+var ErrMismatchedPSSTs = errors.New("psst: cannot combine signatures from two different transactions")
+
+// Input carries everything a signer needs to produce a signature for one
+// of the transaction's siacoin or siafund inputs, without needing to look
+// anything up elsewhere: the UnlockConditions it must satisfy and the
+// CoveredFields a valid signature must commit to.
+type Input struct {
+	ParentID         crypto.Hash
+	UnlockConditions types.UnlockConditions
+	CoveredFields    types.CoveredFields
+}
+
+// PSST (Partially-Signed Sia Transaction) is a serializable envelope
+// carrying an unsigned transaction, the UnlockConditions and sighash flags
+// for each of its inputs, and whatever TransactionSignatures have been
+// accumulated so far.
+type PSST struct {
+	// ID identifies the PSST to the wallet that created it, so that an
+	// abandoned PSST's reserved inputs can be released again (see
+	// Wallet.AbandonPSST). It is left unset when a PSST is constructed by
+	// hand rather than via Wallet.CreatePSST.
+	ID          crypto.Hash
+	Transaction types.Transaction
+	Inputs      []Input
+	Signatures  []types.TransactionSignature
+}
+
+// SignedKeyIndices returns the set of UnlockConditions public-key indices,
+// among p.Signatures, that already carry a signature for parentID. A
+// signer - whether Wallet.SignPSST or any other caller assembling
+// TransactionSignatures by hand - should consult this before adding
+// another signature for an index it already covers, so that re-signing an
+// already-signed PSST doesn't accumulate duplicate TransactionSignatures.
+func (p PSST) SignedKeyIndices(parentID crypto.Hash) map[uint64]bool {
+	signed := make(map[uint64]bool)
+	for _, sig := range p.Signatures {
+		if sig.ParentID == parentID {
+			signed[sig.PublicKeyIndex] = true
+		}
+	}
+	return signed
+}
+
+// Complete reports whether every input's UnlockConditions threshold is met
+// by the signatures accumulated in p.Signatures.
+func (p PSST) Complete() bool {
+	for _, in := range p.Inputs {
+		signed := p.SignedKeyIndices(in.ParentID)
+		if uint64(len(signed)) < in.UnlockConditions.SignaturesRequired {
+			return false
+		}
+	}
+	return true
+}
+
+// Finalize assembles p's accumulated signatures onto p.Transaction and
+// returns the result. It returns ErrIncompleteSignatures if any input's
+// UnlockConditions threshold has not yet been met.
+func (p PSST) Finalize() (types.Transaction, error) {
+	if !p.Complete() {
+		return types.Transaction{}, ErrIncompleteSignatures
+	}
+	txn := p.Transaction
+	txn.TransactionSignatures = append([]types.TransactionSignature(nil), p.Signatures...)
+	return txn, nil
+}
+
+// Combine merges the signatures two cosigners each accumulated on their
+// own copy of the same unsigned PSST back into one. This is what makes
+// multi-party signing parallel rather than strictly sequential: instead
+// of handing a single PSST from cosigner to cosigner and waiting on each
+// in turn, CreatePSST's output can be handed to every cosigner at once,
+// and whatever they each return independently is combined here. It is
+// safe to do only because every CoveredFields the wallet hands out sets
+// WholeTransaction, which (per types.CoveredFields) never covers any
+// other TransactionSignature - each signer's SigHash depends solely on
+// the unsigned transaction body and its own signature's identity, never
+// on who else has signed or in what order, so the signatures two
+// independent signers produce from the same starting PSST remain valid
+// however they're later assembled together.
+//
+// Combine returns ErrMismatchedPSSTs if a and b don't share the same
+// underlying transaction - combining signatures meant for two different
+// PSSTs would silently produce a transaction satisfying neither. Where
+// both a and b carry a signature for the same ParentID and
+// PublicKeyIndex, a's is kept; the two could only differ if the same key
+// signed the same input twice, and since CoveredFields never varies
+// per-signer here, they'd be identical anyway.
+func Combine(a, b PSST) (PSST, error) {
+	if crypto.HashObject(a.Transaction) != crypto.HashObject(b.Transaction) {
+		return PSST{}, ErrMismatchedPSSTs
+	}
+
+	type sigKey struct {
+		parentID crypto.Hash
+		keyIndex uint64
+	}
+	seen := make(map[sigKey]bool, len(a.Signatures))
+	combined := a
+	for _, sig := range a.Signatures {
+		seen[sigKey{sig.ParentID, sig.PublicKeyIndex}] = true
+	}
+	for _, sig := range b.Signatures {
+		k := sigKey{sig.ParentID, sig.PublicKeyIndex}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		combined.Signatures = append(combined.Signatures, sig)
+	}
+	return combined, nil
+}
@@ -0,0 +1,52 @@
+package psst
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestPSSTComplete checks that Complete and Finalize correctly account for
+// the SignaturesRequired threshold of each input.
+func TestPSSTComplete(t *testing.T) {
+	parentID := crypto.Hash{1}
+	p := PSST{
+		Transaction: types.Transaction{},
+		Inputs: []Input{{
+			ParentID: parentID,
+			UnlockConditions: types.UnlockConditions{
+				SignaturesRequired: 2,
+			},
+		}},
+	}
+	if p.Complete() {
+		t.Error("PSST with no signatures should not be complete")
+	}
+	if _, err := p.Finalize(); err != ErrIncompleteSignatures {
+		t.Error("expected ErrIncompleteSignatures, got", err)
+	}
+
+	p.Signatures = append(p.Signatures, types.TransactionSignature{
+		ParentID:       parentID,
+		PublicKeyIndex: 0,
+	})
+	if p.Complete() {
+		t.Error("PSST with one of two required signatures should not be complete")
+	}
+
+	p.Signatures = append(p.Signatures, types.TransactionSignature{
+		ParentID:       parentID,
+		PublicKeyIndex: 1,
+	})
+	if !p.Complete() {
+		t.Error("PSST with both required signatures should be complete")
+	}
+	txn, err := p.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txn.TransactionSignatures) != 2 {
+		t.Error("finalized transaction should carry both signatures")
+	}
+}
@@ -0,0 +1,271 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules/wallet/psst"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestCreateAndSignPSST checks that a PSST created and signed entirely by
+// a single, fully-keyed wallet finalizes into a valid transaction.
+func TestCreateAndSignPSST(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestCreateAndSignPSST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	uc, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := wt.wallet.CreatePSST([]types.SiacoinOutput{{
+		Value:      types.SiacoinPrecision,
+		UnlockHash: uc.UnlockHash(),
+	}}, types.SiacoinPrecision.Div64(1e3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Complete() {
+		t.Error("freshly created PSST should not already be complete")
+	}
+
+	p, err = wt.wallet.SignPSST(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Complete() {
+		t.Fatal("PSST signed by the only required signer should be complete")
+	}
+	if _, err := p.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCreatePSSTReservesInputs checks that the inputs CreatePSST selects
+// stay reserved - unavailable to a later CreatePSST/SendSiacoins from the
+// same wallet - until the PSST is explicitly abandoned.
+func TestCreatePSSTReservesInputs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestCreatePSSTReservesInputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	uc, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	siacoinBal, _, err := wt.wallet.ConfirmedBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fee := types.SiacoinPrecision
+	spend := siacoinBal.Sub(fee)
+
+	p, err := wt.wallet.CreatePSST([]types.SiacoinOutput{{
+		Value:      spend,
+		UnlockHash: uc.UnlockHash(),
+	}}, fee)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second PSST spending nearly the whole balance should fail: the
+	// first PSST's inputs are still reserved.
+	if _, err := wt.wallet.CreatePSST([]types.SiacoinOutput{{
+		Value:      spend,
+		UnlockHash: uc.UnlockHash(),
+	}}, fee); err == nil {
+		t.Fatal("expected CreatePSST to fail while the first PSST's inputs are still reserved")
+	}
+
+	if err := wt.wallet.AbandonPSST(p); err != nil {
+		t.Fatal(err)
+	}
+
+	// Now that the first PSST has been abandoned, its inputs should be
+	// available again.
+	if _, err := wt.wallet.CreatePSST([]types.SiacoinOutput{{
+		Value:      spend,
+		UnlockHash: uc.UnlockHash(),
+	}}, fee); err != nil {
+		t.Fatalf("CreatePSST should succeed after the conflicting PSST was abandoned: %v", err)
+	}
+}
+
+// TestSignPSSTSkipsWatchOnly checks that SignPSST leaves watch-only inputs
+// unsigned instead of erroring.
+func TestSignPSSTSkipsWatchOnly(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestSignPSSTSkipsWatchOnly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	seed, _, err := wt.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := wt.wallet.ExtendedPublicKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcherDir := wt.wallet.persistDir + "-watcher"
+	watcher, err := New(wt.cs, wt.tpool, watcherDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	watcherSeed, err := watcher.Encrypt(crypto.TwofishKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.Unlock(crypto.TwofishKey(crypto.HashObject(watcherSeed))); err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.LoadWatchOnly(xpub); err != nil {
+		t.Fatal(err)
+	}
+
+	// Build a PSST whose only input spends the first address covered by
+	// xpub. It doesn't need to correspond to a real UTXO: SignPSST only
+	// looks at whether the wallet holds a private key for the input's
+	// UnlockConditions.
+	uc := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{xpub.PublicKeys[0]},
+		SignaturesRequired: 1,
+	}
+	p := psst.PSST{
+		Inputs: []psst.Input{{
+			ParentID:         crypto.Hash{1, 2, 3},
+			UnlockConditions: uc,
+			CoveredFields:    types.CoveredFields{WholeTransaction: true},
+		}},
+	}
+	signed, err := watcher.SignPSST(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signed.Signatures) != 0 {
+		t.Error("watch-only wallet should not have produced any signatures")
+	}
+}
+
+// TestSignPSSTSkipsAlreadySigned checks that calling SignPSST twice on the
+// same PSST does not append a second, duplicate TransactionSignature for
+// an input/key pair it already signed.
+func TestSignPSSTSkipsAlreadySigned(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestSignPSSTSkipsAlreadySigned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	uc, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := wt.wallet.CreatePSST([]types.SiacoinOutput{{
+		Value:      types.SiacoinPrecision,
+		UnlockHash: uc.UnlockHash(),
+	}}, types.SiacoinPrecision.Div64(1e3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = wt.wallet.SignPSST(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstCount := len(p.Signatures)
+	if firstCount == 0 {
+		t.Fatal("expected SignPSST to have produced at least one signature")
+	}
+
+	p, err = wt.wallet.SignPSST(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Signatures) != firstCount {
+		t.Errorf("re-signing an already-signed PSST should not change its signature count: got %v, want %v", len(p.Signatures), firstCount)
+	}
+}
+
+// TestCombineParallelSignatures checks that two cosigners independently
+// signing their own copy of the same unsigned PSST - rather than one
+// handing it off to the other in sequence - can be merged back into a
+// single complete PSST with psst.Combine.
+func TestCombineParallelSignatures(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestCombineParallelSignatures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	uc, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := wt.wallet.CreatePSST([]types.SiacoinOutput{{
+		Value:      types.SiacoinPrecision,
+		UnlockHash: uc.UnlockHash(),
+	}}, types.SiacoinPrecision.Div64(1e3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate two independent cosigners each starting from the same
+	// unsigned PSST, rather than one signing the other's output.
+	signedA, err := wt.wallet.SignPSST(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedB, err := wt.wallet.SignPSST(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	combined, err := psst.Combine(signedA, signedB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !combined.Complete() {
+		t.Fatal("combining two independently-signed copies of a single-signer PSST should be complete")
+	}
+	if len(combined.Signatures) != len(signedA.Signatures) {
+		t.Errorf("combining two identical signer sets should not duplicate signatures: got %v, want %v", len(combined.Signatures), len(signedA.Signatures))
+	}
+	if _, err := combined.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	mismatched, err := wt.wallet.CreatePSST([]types.SiacoinOutput{{
+		Value:      types.SiacoinPrecision,
+		UnlockHash: uc.UnlockHash(),
+	}}, types.SiacoinPrecision.Div64(1e3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := psst.Combine(signedA, mismatched); err != psst.ErrMismatchedPSSTs {
+		t.Error("expected ErrMismatchedPSSTs when combining signatures from two different transactions, got", err)
+	}
+}
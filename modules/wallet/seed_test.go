@@ -156,42 +156,25 @@ func TestLoadSeed(t *testing.T) {
 	if !bytes.Equal(allSeeds[1][:], seed[:]) {
 		t.Error("AllSeeds returned the wrong seed")
 	}
-	w.Close()
 
-	// Rather than worry about a rescan, which isn't implemented and has
-	// synchronization difficulties, just load a new wallet from the same
-	// settings file - the same effect is achieved without the difficulties.
-	//
-	// TODO: when proper seed loading is implemented, just check the balance
-	// of w directly.
-	w2, err := New(wt.cs, wt.tpool, dir)
-	if err != nil {
-		t.Fatal(err)
-	}
-	// reset the ccID so that the wallet does a full rescan
-	resetChangeID(w2)
-	err = w2.Unlock(crypto.TwofishKey(crypto.HashObject(newSeed)))
-	if err != nil {
+	// Now that RescanFromBirthday exists, the balance attached to the
+	// recovered seed can be checked directly on w instead of reopening a
+	// second wallet and forcing a full ConsensusChangeBeginning rescan.
+	if err := w.RescanFromBirthday(); err != nil {
 		t.Fatal(err)
 	}
-	siacoinBal2, _, _ := w2.ConfirmedBalance()
-	if siacoinBal2.Cmp(types.NewCurrency64(0)) <= 0 {
-		t.Error("wallet failed to load a seed with money in it")
-	}
-	allSeeds, err = w2.AllSeeds()
+	status, err := w.RescanStatus()
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(allSeeds) != 2 {
-		t.Error("AllSeeds should be returning the primary seed with the recovery seed.")
-	}
-	if !bytes.Equal(allSeeds[0][:], newSeed[:]) {
-		t.Error("AllSeeds returned the wrong seed")
+	if !status.Complete {
+		t.Error("rescan from birthday should have completed")
 	}
-	if !bytes.Equal(allSeeds[1][:], seed[:]) {
-		t.Error("AllSeeds returned the wrong seed")
+	siacoinBal, _, _ = w.ConfirmedBalance()
+	if siacoinBal.Cmp(types.NewCurrency64(0)) <= 0 {
+		t.Error("wallet failed to load a seed with money in it")
 	}
-	w2.Close()
+	w.Close()
 }
 
 // TestSweepSeed tests that sweeping a seed results in a transfer of its
@@ -0,0 +1,227 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestExtendedPublicKey checks that ExtendedPublicKey derives a stable
+// descriptor covering xpubLookaheadKeys addresses.
+func TestExtendedPublicKey(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestExtendedPublicKey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	seed, _, err := wt.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := wt.wallet.ExtendedPublicKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(xpub.PublicKeys) != xpubLookaheadKeys {
+		t.Errorf("expected %v public keys, got %v", xpubLookaheadKeys, len(xpub.PublicKeys))
+	}
+	xpub2, err := wt.wallet.ExtendedPublicKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xpub.ChainCode != xpub2.ChainCode {
+		t.Error("ExtendedPublicKey should be deterministic in the chain code it derives")
+	}
+}
+
+// TestLoadWatchOnly checks that a wallet loaded with another wallet's xpub
+// can see its addresses but never its private keys.
+func TestLoadWatchOnly(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestLoadWatchOnly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+	seed, _, err := wt.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := wt.wallet.ExtendedPublicKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := build.TempDir(modules.WalletDir, "TestLoadWatchOnly - watcher")
+	watcher, err := New(wt.cs, wt.tpool, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	if _, err := watcher.Encrypt(crypto.TwofishKey{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.LoadWatchOnly(xpub); err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.LoadWatchOnly(xpub); err != errXPubAlreadyLoaded {
+		t.Error("expected re-loading the same xpub to fail, got", err)
+	}
+
+	watcher.mu.RLock()
+	for _, sk := range watcher.keys {
+		if len(sk.SecretKeys) != 0 {
+			t.Fatal("watch-only wallet should not hold any private keys")
+		}
+	}
+	watcher.mu.RUnlock()
+}
+
+// TestLoadWatchOnlyAfterRestart checks that a watch-only wallet recovers
+// its tracked addresses after being closed and reopened, even though
+// nothing yet calls loadWatchOnlyXPubs from wallet startup: LoadWatchOnly
+// itself must be able to recover from the persisted bucket instead of
+// permanently failing with errXPubAlreadyLoaded.
+func TestLoadWatchOnlyAfterRestart(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestLoadWatchOnlyAfterRestart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+	seed, _, err := wt.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := wt.wallet.ExtendedPublicKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := build.TempDir(modules.WalletDir, "TestLoadWatchOnlyAfterRestart - watcher")
+	watcher, err := New(wt.cs, wt.tpool, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watcher.Encrypt(crypto.TwofishKey{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.LoadWatchOnly(xpub); err != nil {
+		t.Fatal(err)
+	}
+	watcher.Close()
+
+	reopened, err := New(wt.cs, wt.tpool, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if len(reopened.keys) != 0 {
+		t.Fatal("freshly reopened watcher should not have repopulated w.keys on its own")
+	}
+	if err := reopened.LoadWatchOnly(xpub); err != nil {
+		t.Fatal("LoadWatchOnly should recover a previously-persisted xpub instead of erroring, got", err)
+	}
+	reopened.mu.RLock()
+	defer reopened.mu.RUnlock()
+	if len(reopened.keys) != len(xpub.PublicKeys) {
+		t.Errorf("expected %v recovered watch-only keys, got %v", len(xpub.PublicKeys), len(reopened.keys))
+	}
+}
+
+// TestLoadWatchOnlyAfterRestartMultipleXPubs checks that every xpub loaded
+// in a previous run is recovered even when the first LoadWatchOnly call
+// after a restart is for a brand new xpub the wallet has never seen,
+// rather than one of the previously-persisted ones.
+func TestLoadWatchOnlyAfterRestartMultipleXPubs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wtA, err := createWalletTester("TestLoadWatchOnlyAfterRestartMultipleXPubs - A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wtA.closeWt()
+	seedA, _, err := wtA.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpubA, err := wtA.wallet.ExtendedPublicKey(seedA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wtB, err := createWalletTester("TestLoadWatchOnlyAfterRestartMultipleXPubs - B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wtB.closeWt()
+	seedB, _, err := wtB.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpubB, err := wtB.wallet.ExtendedPublicKey(seedB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := build.TempDir(modules.WalletDir, "TestLoadWatchOnlyAfterRestartMultipleXPubs - watcher")
+	watcher, err := New(wtA.cs, wtA.tpool, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watcher.Encrypt(crypto.TwofishKey{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.LoadWatchOnly(xpubA); err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.LoadWatchOnly(xpubB); err != nil {
+		t.Fatal(err)
+	}
+	watcher.Close()
+
+	reopened, err := New(wtA.cs, wtA.tpool, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	wtC, err := createWalletTester("TestLoadWatchOnlyAfterRestartMultipleXPubs - C")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wtC.closeWt()
+	seedC, _, err := wtC.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpubC, err := wtC.wallet.ExtendedPublicKey(seedC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first call after the restart names a brand new xpub C, never
+	// before seen by this wallet. It must not prevent A and B - loaded in
+	// the previous run - from being recovered too.
+	if err := reopened.LoadWatchOnly(xpubC); err != nil {
+		t.Fatal("LoadWatchOnly with a never-before-seen xpub should still succeed, got", err)
+	}
+
+	reopened.mu.RLock()
+	defer reopened.mu.RUnlock()
+	want := len(xpubA.PublicKeys) + len(xpubB.PublicKeys) + len(xpubC.PublicKeys)
+	if len(reopened.keys) != want {
+		t.Errorf("expected %v recovered watch-only keys across A, B, and C, got %v", want, len(reopened.keys))
+	}
+}